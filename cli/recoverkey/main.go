@@ -0,0 +1,69 @@
+// Steve Phillips / elimisteve
+// 2015.03.23
+
+// Command recoverkey prints a vault's recovery phrase on creation and
+// re-derives the key from a previously printed phrase.
+//
+// Usage:
+//
+//	recoverkey encode <32-byte key, hex-encoded>
+//	recoverkey decode <word1> <word2> ...
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/elimisteve/cryptag/recovery"
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "encode":
+		encode(os.Args[2])
+	case "decode":
+		decode(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: recoverkey encode <hex key> | recoverkey decode <word1> <word2> ...")
+	os.Exit(1)
+}
+
+func encode(hexKey string) {
+	raw, err := hex.DecodeString(hexKey)
+	if err != nil || len(raw) != 32 {
+		fmt.Fprintf(os.Stderr, "recoverkey: key must be 32 bytes, hex-encoded: %v\n", err)
+		os.Exit(1)
+	}
+
+	key := new([32]byte)
+	copy(key[:], raw)
+
+	words, err := recovery.EncodeKey(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recoverkey: error encoding key: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(strings.Join(words, " "))
+}
+
+func decode(words []string) {
+	key, err := recovery.DecodeKey(words)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recoverkey: error decoding phrase: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(hex.EncodeToString(key[:]))
+}
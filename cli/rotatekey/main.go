@@ -0,0 +1,109 @@
+// Steve Phillips / elimisteve
+// 2015.03.30
+
+// Command rotate-key re-encrypts every row in a backend from an old
+// key to a new one, the standard "I think my key was exposed"
+// workflow. It's resumable: pass the rotation tag printed by an
+// interrupted run as a 4th argument and it'll pick up where that run
+// left off instead of starting over.
+//
+// loadBackend below is a stub: no backend package is linked into this
+// command yet, so as it stands every invocation fails at the "loading
+// backend" step rather than rotating anything. The rotation logic
+// itself (types.Rotate, types.RotateBackend) is otherwise complete;
+// what's missing is wiring backendConfig to a real backend.
+//
+// Usage:
+//
+//	rotate-key <backend config> <old key, hex> <new key, hex> [resume tag]
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/elimisteve/cryptag"
+	"github.com/elimisteve/cryptag/types"
+)
+
+func main() {
+	if len(os.Args) != 4 && len(os.Args) != 5 {
+		fmt.Fprintln(os.Stderr, "Usage: rotate-key <backend config> <old key, hex> <new key, hex> [resume tag]")
+		os.Exit(1)
+	}
+
+	backendConfig, oldKeyHex, newKeyHex := os.Args[1], os.Args[2], os.Args[3]
+	var resumeTag string
+	if len(os.Args) == 5 {
+		resumeTag = os.Args[4]
+	}
+
+	oldKey, err := parseKey(oldKeyHex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rotate-key: invalid old key: %v\n", err)
+		os.Exit(1)
+	}
+	newKey, err := parseKey(newKeyHex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rotate-key: invalid new key: %v\n", err)
+		os.Exit(1)
+	}
+
+	backend, err := loadBackend(backendConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rotate-key: error loading backend %q: %v\n", backendConfig, err)
+		os.Exit(1)
+	}
+
+	// RotateBackend persists RotationProgress encrypted with newKey
+	// (it's the only key guaranteed to exist once rotation finishes),
+	// so it must be loaded with newKey too.
+	progress, err := loadOrStartProgress(backend, newKey, resumeTag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rotate-key: error loading rotation progress: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "rotate-key: rotation tag %s\n", progress.Tag)
+
+	if err := types.RotateBackend(backend, oldKey, newKey, progress); err != nil {
+		fmt.Fprintf(os.Stderr, "rotate-key: rotation tag %s: error rotating key: %v\n", progress.Tag, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Rotated %d row(s) to the new key. Rotation tag: %s\n", len(progress.Completed), progress.Tag)
+}
+
+func parseKey(hexKey string) (*[32]byte, error) {
+	raw, err := hex.DecodeString(hexKey)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, hex-encoded")
+	}
+	key := new([32]byte)
+	copy(key[:], raw)
+	return key, nil
+}
+
+// loadOrStartProgress resumes the RotationProgress tagged resumeTag if
+// one was given, or starts a fresh one tagged with the current time
+// otherwise.  The caller prints the Tag before rotating so it can be
+// passed back in as resumeTag if this run is interrupted.
+func loadOrStartProgress(backend types.RotationBackend, newKey *[32]byte, resumeTag string) (*types.RotationProgress, error) {
+	if resumeTag == "" {
+		return types.NewRotationProgress(cryptag.TimeStr(cryptag.Now())), nil
+	}
+	return types.LoadRotationProgress(resumeTag, newKey, backend)
+}
+
+// loadBackend is backend-specific and is NOT implemented by this
+// command as it stands: no backend package (webserver, sandstorm,
+// dropbox, ...) is linked in, so loadBackend always errors and
+// rotate-key cannot currently rotate a real vault.  Wiring up an
+// actual rotation run means replacing this function with one that
+// constructs and returns a types.RotationBackend for backendConfig,
+// analogous to how the rest of this codebase's commands load their
+// backend.
+func loadBackend(backendConfig string) (types.RotationBackend, error) {
+	return nil, fmt.Errorf("no backend wired up for %q; loadBackend is a stub, see its doc comment", backendConfig)
+}
@@ -0,0 +1,113 @@
+// Steve Phillips / elimisteve
+// 2015.03.23
+
+package recovery
+
+// GF(256) arithmetic over the primitive polynomial x^8 + x^4 + x^3 +
+// x^2 + 1 (0x11d), the same field used by QR codes' Reed-Solomon ECC.
+// gfExp/gfLog are log/antilog tables built once at init time so
+// multiplication and division are table lookups instead of per-call
+// polynomial reduction.
+
+const gfExpSize = 512
+
+var (
+	gfExp [gfExpSize]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[byte(x)] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < gfExpSize; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	if b == 0 {
+		panic("recovery: division by zero in GF(256)")
+	}
+	return gfExp[(int(gfLog[a])+255-int(gfLog[b]))%255]
+}
+
+func gfPow(a byte, power int) byte {
+	if a == 0 {
+		if power == 0 {
+			return 1
+		}
+		return 0
+	}
+	e := (int(gfLog[a]) * power) % 255
+	if e < 0 {
+		e += 255
+	}
+	return gfExp[e]
+}
+
+func gfInverse(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfPolyMul multiplies two polynomials given highest-degree-coefficient-first.
+func gfPolyMul(p, q []byte) []byte {
+	out := make([]byte, len(p)+len(q)-1)
+	for j := range q {
+		if q[j] == 0 {
+			continue
+		}
+		for i := range p {
+			out[i+j] ^= gfMul(p[i], q[j])
+		}
+	}
+	return out
+}
+
+// gfPolyEval evaluates polynomial p (highest-degree first) at x.
+func gfPolyEval(p []byte, x byte) byte {
+	y := p[0]
+	for i := 1; i < len(p); i++ {
+		y = gfMul(y, x) ^ p[i]
+	}
+	return y
+}
+
+// gfPolyScale multiplies every coefficient of p by x.
+func gfPolyScale(p []byte, x byte) []byte {
+	out := make([]byte, len(p))
+	for i, c := range p {
+		out[i] = gfMul(c, x)
+	}
+	return out
+}
+
+// gfPolyAdd adds (XORs) two polynomials, right-aligning the shorter one.
+func gfPolyAdd(p, q []byte) []byte {
+	n := len(p)
+	if len(q) > n {
+		n = len(q)
+	}
+	out := make([]byte, n)
+	copy(out[n-len(p):], p)
+	for i, c := range q {
+		out[n-len(q)+i] ^= c
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+// Steve Phillips / elimisteve
+// 2015.03.23
+
+// Package recovery turns a Row encryption key into a human-writable
+// recovery phrase and back, following the wordcodec-plus-Reed-Solomon
+// approach used by tendermint's cryptostore keys package: the raw key
+// bytes (plus a one-byte checksum) get a short Reed-Solomon parity
+// block appended, and each resulting byte is rendered as one word
+// from a fixed, bundled 2048-word list.
+package recovery
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	keyLen = 32 // bytes in a Row encryption key
+	nsym   = 4  // RS parity bytes; corrects up to nsym/2 corrupted symbols
+
+	// Each word encodes exactly one RS byte symbol (0-255), a small
+	// slice of the 2048-word list left otherwise unused. This trades
+	// phrase length for a hard guarantee that one mistyped or
+	// misremembered word can never perturb more than a single RS
+	// symbol, unlike an 11-bit bit-packed encoding, where a word
+	// generally straddles parts of two or three adjacent bytes and a
+	// single substitution can exceed what nsym/2 can correct.
+	dataLen = keyLen + 1 // key bytes plus a one-byte checksum
+)
+
+// numWords is how many words EncodeKey always produces.
+func numWords() int {
+	return dataLen + nsym
+}
+
+// checksumByte returns a single byte derived from key, used as an
+// integrity check independent of the Reed-Solomon parity: RS can, in
+// principle, "correct" a message with more errors than it can
+// actually handle and return a plausible-looking but wrong result
+// with no error. Comparing against checksumByte catches that case
+// instead of silently handing back the wrong key.
+func checksumByte(key *[32]byte) byte {
+	sum := sha256.Sum256(key[:])
+	return sum[0]
+}
+
+// EncodeKey returns key as a recovery phrase: key's bytes, a one-byte
+// checksum, and a Reed-Solomon parity block, each byte rendered as one
+// word from the bundled word list.
+func EncodeKey(key *[32]byte) ([]string, error) {
+	if key == nil {
+		return nil, fmt.Errorf("recovery: EncodeKey: key must not be nil")
+	}
+
+	data := make([]byte, dataLen)
+	copy(data, key[:])
+	data[keyLen] = checksumByte(key)
+
+	msg := rsEncode(data, nsym)
+
+	words := make([]string, len(msg))
+	for i, b := range msg {
+		words[i] = wordlist[b]
+	}
+
+	return words, nil
+}
+
+// DecodeKey reverses EncodeKey, using its Reed-Solomon parity to
+// correct up to nsym/2 corrupted symbols -- enough to recover from one
+// misremembered word, since each word is exactly one RS symbol. Words
+// not found in the word list are treated as an erroneous zero byte and
+// rely entirely on RS correction, same as a plain substitution error.
+//
+// The decoded key is additionally checked against the recovery
+// phrase's embedded checksum byte; a mismatch means the corruption
+// exceeded what nsym/2 can correct, and an error is returned rather
+// than a silently-wrong key.
+func DecodeKey(words []string) (*[32]byte, error) {
+	if want := numWords(); len(words) != want {
+		return nil, fmt.Errorf("recovery: DecodeKey: want %d words, got %d", want, len(words))
+	}
+
+	msg := make([]byte, len(words))
+	for i, w := range words {
+		idx, ok := wordIndex[w]
+		if !ok || idx > 255 {
+			idx = 0
+		}
+		msg[i] = byte(idx)
+	}
+
+	data, err := rsDecode(msg, nsym)
+	if err != nil {
+		return nil, fmt.Errorf("recovery: could not recover key from phrase: %v", err)
+	}
+
+	key := new([32]byte)
+	copy(key[:], data[:keyLen])
+
+	if data[keyLen] != checksumByte(key) {
+		return nil, fmt.Errorf("recovery: checksum mismatch; phrase has more errors than could be corrected")
+	}
+
+	return key, nil
+}
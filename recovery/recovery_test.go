@@ -0,0 +1,149 @@
+// Steve Phillips / elimisteve
+// 2015.03.24
+
+package recovery
+
+import "testing"
+
+func testKey(seed byte) *[32]byte {
+	key := new([32]byte)
+	for i := range key {
+		key[i] = byte(int(seed)*97 + i*7)
+	}
+	return key
+}
+
+func testKeys() []*[32]byte {
+	return []*[32]byte{testKey(0), testKey(1), testKey(2), testKey(3)}
+}
+
+func TestEncodeDecodeKeyRoundTrip(t *testing.T) {
+	for _, key := range testKeys() {
+		words, err := EncodeKey(key)
+		if err != nil {
+			t.Fatalf("EncodeKey: %v", err)
+		}
+		if len(words) != numWords() {
+			t.Fatalf("EncodeKey: got %d words, want %d", len(words), numWords())
+		}
+
+		got, err := DecodeKey(words)
+		if err != nil {
+			t.Fatalf("DecodeKey: %v", err)
+		}
+		if *got != *key {
+			t.Fatalf("DecodeKey: got %x, want %x", *got, *key)
+		}
+	}
+}
+
+// TestDecodeKeyCorrectsOneBadWordAtEveryPosition corrupts exactly one
+// word -- substituted with a different valid word from the list --
+// at every position in the phrase, for several distinct keys, and
+// checks that the original key is always recovered exactly. Because
+// each word is exactly one RS symbol (see recovery.go), a single bad
+// word is always within the nsym/2 symbols DecodeKey can correct,
+// regardless of which word or byte position it lands on.
+func TestDecodeKeyCorrectsOneBadWordAtEveryPosition(t *testing.T) {
+	for ki, key := range testKeys() {
+		words, err := EncodeKey(key)
+		if err != nil {
+			t.Fatalf("key %d: EncodeKey: %v", ki, err)
+		}
+
+		for pos := range words {
+			corrupted := append([]string{}, words...)
+			origIdx := wordIndex[corrupted[pos]]
+			corrupted[pos] = wordlist[(origIdx+1)%len(wordlist)]
+
+			got, err := DecodeKey(corrupted)
+			if err != nil {
+				t.Fatalf("key %d, word %d: DecodeKey: %v", ki, pos, err)
+			}
+			if *got != *key {
+				t.Fatalf("key %d, word %d: got %x, want %x", ki, pos, *got, *key)
+			}
+		}
+	}
+}
+
+// TestDecodeKeyCorrectsOneUnknownWordAtEveryPosition is
+// TestDecodeKeyCorrectsOneBadWordAtEveryPosition's sibling for a
+// misremembered word that isn't in the word list at all (decoded as a
+// zero byte and corrected like any other substitution), again at every
+// position.
+func TestDecodeKeyCorrectsOneUnknownWordAtEveryPosition(t *testing.T) {
+	for ki, key := range testKeys() {
+		words, err := EncodeKey(key)
+		if err != nil {
+			t.Fatalf("key %d: EncodeKey: %v", ki, err)
+		}
+
+		for pos := range words {
+			corrupted := append([]string{}, words...)
+			corrupted[pos] = "notarealword"
+
+			got, err := DecodeKey(corrupted)
+			if err != nil {
+				t.Fatalf("key %d, word %d: DecodeKey: %v", ki, pos, err)
+			}
+			if *got != *key {
+				t.Fatalf("key %d, word %d: got %x, want %x", ki, pos, *got, *key)
+			}
+		}
+	}
+}
+
+// TestDecodeKeyCorrectsTwoBadWords checks correction at the edge of
+// what nsym/2 guarantees: two simultaneously bad words anywhere in the
+// phrase.
+func TestDecodeKeyCorrectsTwoBadWords(t *testing.T) {
+	key := testKey(7)
+	words, err := EncodeKey(key)
+	if err != nil {
+		t.Fatalf("EncodeKey: %v", err)
+	}
+
+	corrupted := append([]string{}, words...)
+	for _, pos := range []int{2, len(words) - 3} {
+		origIdx := wordIndex[corrupted[pos]]
+		corrupted[pos] = wordlist[(origIdx+5)%len(wordlist)]
+	}
+
+	got, err := DecodeKey(corrupted)
+	if err != nil {
+		t.Fatalf("DecodeKey with two bad words: %v", err)
+	}
+	if *got != *key {
+		t.Fatalf("DecodeKey with two bad words: got %x, want %x", *got, *key)
+	}
+}
+
+// TestDecodeKeyDetectsUncorrectableCorruption checks that corruption
+// beyond nsym/2 symbols is reported as an error -- via the RS decode
+// failing outright, or via the checksum byte catching a miscorrection
+// -- rather than silently returning a wrong key.
+func TestDecodeKeyDetectsUncorrectableCorruption(t *testing.T) {
+	key := testKey(9)
+	words, err := EncodeKey(key)
+	if err != nil {
+		t.Fatalf("EncodeKey: %v", err)
+	}
+
+	corrupted := append([]string{}, words...)
+	for _, pos := range []int{0, 3, 6} {
+		origIdx := wordIndex[corrupted[pos]]
+		corrupted[pos] = wordlist[(origIdx+11)%len(wordlist)]
+	}
+
+	got, err := DecodeKey(corrupted)
+	if err == nil {
+		t.Fatalf("DecodeKey: expected error for 3 corrupted words, got key %x", *got)
+	}
+}
+
+func TestDecodeKeyWrongWordCount(t *testing.T) {
+	if _, err := DecodeKey([]string{"too", "few", "words"}); err == nil {
+		t.Fatal("DecodeKey: expected error for wrong word count, got nil")
+	}
+}
@@ -0,0 +1,204 @@
+// Steve Phillips / elimisteve
+// 2015.03.23
+
+package recovery
+
+import "fmt"
+
+// rsGeneratorPoly returns the degree-nsym generator polynomial
+// g(x) = (x - 2^0)(x - 2^1)...(x - 2^(nsym-1)) used to compute parity
+// symbols, highest-degree coefficient first.
+func rsGeneratorPoly(nsym int) []byte {
+	g := []byte{1}
+	for i := 0; i < nsym; i++ {
+		g = gfPolyMul(g, []byte{1, gfPow(2, i)})
+	}
+	return g
+}
+
+// rsEncode returns msg with nsym Reed-Solomon parity symbols appended.
+func rsEncode(msg []byte, nsym int) []byte {
+	gen := rsGeneratorPoly(nsym)
+
+	remainder := make([]byte, len(msg)+len(gen)-1)
+	copy(remainder, msg)
+
+	for i := 0; i < len(msg); i++ {
+		coef := remainder[i]
+		if coef == 0 {
+			continue
+		}
+		for j := 1; j < len(gen); j++ {
+			remainder[i+j] ^= gfMul(gen[j], coef)
+		}
+	}
+
+	out := make([]byte, len(msg)+nsym)
+	copy(out, msg)
+	copy(out[len(msg):], remainder[len(msg):])
+	return out
+}
+
+// rsSyndromes returns msg's nsym syndromes; all-zero means msg (data
+// plus parity) has no detectable errors.
+func rsSyndromes(msg []byte, nsym int) []byte {
+	synd := make([]byte, nsym)
+	for i := 0; i < nsym; i++ {
+		synd[i] = gfPolyEval(msg, gfPow(2, i))
+	}
+	return synd
+}
+
+func allZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// rsErrorLocator runs the Berlekamp-Massey algorithm over syndromes
+// synd, returning the error locator polynomial whose roots' inverses
+// are the error positions.
+func rsErrorLocator(synd []byte, maxErrors int) ([]byte, error) {
+	errLoc := []byte{1}
+	oldLoc := []byte{1}
+
+	for i := 0; i < len(synd); i++ {
+		oldLoc = append(oldLoc, 0)
+
+		delta := synd[i]
+		for j := 1; j < len(errLoc); j++ {
+			delta ^= gfMul(errLoc[len(errLoc)-1-j], synd[i-j])
+		}
+
+		if delta != 0 {
+			if len(oldLoc) > len(errLoc) {
+				newLoc := gfPolyScale(oldLoc, delta)
+				oldLoc = gfPolyScale(errLoc, gfInverse(delta))
+				errLoc = newLoc
+			}
+			errLoc = gfPolyAdd(errLoc, gfPolyScale(oldLoc, delta))
+		}
+	}
+
+	errLoc = trimLeadingZeros(errLoc)
+	numErrors := len(errLoc) - 1
+	if numErrors > maxErrors {
+		return nil, fmt.Errorf("recovery: too many errors to correct (found %d, can fix %d)", numErrors, maxErrors)
+	}
+	return errLoc, nil
+}
+
+func trimLeadingZeros(p []byte) []byte {
+	i := 0
+	for i < len(p)-1 && p[i] == 0 {
+		i++
+	}
+	return p[i:]
+}
+
+// rsFindErrors runs Chien search over errLoc to find the index (from
+// the start of a msgLen-symbol message) of each error.
+func rsFindErrors(errLoc []byte, msgLen int) ([]int, error) {
+	numErrors := len(errLoc) - 1
+	var errPos []int
+	for i := 0; i < msgLen; i++ {
+		x := gfPow(2, i)
+		inv := gfInverse(x)
+		if gfPolyEval(errLoc, inv) == 0 {
+			errPos = append(errPos, msgLen-1-i)
+		}
+	}
+	if len(errPos) != numErrors {
+		return nil, fmt.Errorf("recovery: error locator has %d roots in range, expected %d", len(errPos), numErrors)
+	}
+	return errPos, nil
+}
+
+// rsCorrectErrata uses the Forney algorithm to compute error
+// magnitudes at errPos and returns a corrected copy of msg.
+func rsCorrectErrata(msg []byte, synd []byte, errPos []int) ([]byte, error) {
+	xs := make([]byte, len(errPos))
+	for i, pos := range errPos {
+		xs[i] = gfPow(2, len(msg)-1-pos)
+	}
+
+	errLoc := []byte{1}
+	for _, x := range xs {
+		errLoc = gfPolyMul(errLoc, []byte{x, 1})
+	}
+
+	// Reverse syndromes to build the error evaluator polynomial
+	// Omega(x) = S(x) * ErrLoc(x) mod x^nsym.
+	synRev := make([]byte, len(synd))
+	for i, v := range synd {
+		synRev[len(synd)-1-i] = v
+	}
+	errEval := gfPolyMul(synRev, errLoc)
+	if len(errEval) > len(synd) {
+		errEval = errEval[len(errEval)-len(synd):]
+	}
+
+	corrected := append([]byte{}, msg...)
+	for i, pos := range errPos {
+		xInv := gfInverse(xs[i])
+
+		// errLocPrime is prod_{j != i} (1 - X_i^-1 * X_j), which is
+		// Lambda'(xInv) divided by X_i. Forney's numerator carries the
+		// same X_i factor (first consecutive root 2^0), and y below
+		// leaves it out too, so the two cancel in the magnitude.
+		errLocPrime := byte(1)
+		for j, xj := range xs {
+			if j == i {
+				continue
+			}
+			errLocPrime = gfMul(errLocPrime, 1^gfMul(xInv, xj))
+		}
+		if errLocPrime == 0 {
+			return nil, fmt.Errorf("recovery: could not compute error magnitude at position %d", pos)
+		}
+
+		y := gfPolyEval(errEval, xInv)
+		magnitude := gfDiv(y, errLocPrime)
+		corrected[pos] ^= magnitude
+	}
+
+	return corrected, nil
+}
+
+// rsDecode corrects up to nsym/2 symbol errors in msg (data followed
+// by nsym parity symbols) and returns the original data with parity
+// stripped.
+func rsDecode(msg []byte, nsym int) ([]byte, error) {
+	if len(msg) < nsym {
+		return nil, fmt.Errorf("recovery: message shorter than parity length")
+	}
+
+	synd := rsSyndromes(msg, nsym)
+	if allZero(synd) {
+		return append([]byte{}, msg[:len(msg)-nsym]...), nil
+	}
+
+	errLoc, err := rsErrorLocator(synd, nsym/2)
+	if err != nil {
+		return nil, err
+	}
+
+	errPos, err := rsFindErrors(errLoc, len(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	corrected, err := rsCorrectErrata(msg, synd, errPos)
+	if err != nil {
+		return nil, err
+	}
+
+	if !allZero(rsSyndromes(corrected, nsym)) {
+		return nil, fmt.Errorf("recovery: failed to fully correct errors")
+	}
+
+	return corrected[:len(corrected)-nsym], nil
+}
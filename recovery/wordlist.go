@@ -0,0 +1,34 @@
+// Steve Phillips / elimisteve
+// 2015.03.23
+
+package recovery
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+//go:embed wordlist.txt
+var wordlistRaw string
+
+// wordlist is the fixed, 2048-entry word list recovery phrases are
+// drawn from. Its entries are short, pronounceable made-up words, not
+// English ones. Each word stands for one byte (see recovery.go), so
+// only the first 256 entries ever appear in a phrase.
+var wordlist []string
+
+// wordIndex maps each wordlist entry back to its index for decoding.
+var wordIndex map[string]int
+
+func init() {
+	wordlist = strings.Split(strings.TrimSpace(wordlistRaw), "\n")
+	if len(wordlist) != 2048 {
+		panic(fmt.Sprintf("recovery: embedded wordlist has %d entries, want 2048", len(wordlist)))
+	}
+
+	wordIndex = make(map[string]int, len(wordlist))
+	for i, w := range wordlist {
+		wordIndex[w] = i
+	}
+}
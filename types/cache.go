@@ -0,0 +1,217 @@
+// Steve Phillips / elimisteve
+// 2015.03.16
+
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/elimisteve/cryptag"
+)
+
+// DefaultCacheTTL is how long a CacheEntry is considered fresh before
+// PopulateCached falls back to a full Populate.
+const DefaultCacheTTL = 10 * time.Minute
+
+// CacheEntry is what a Cache stores per (backendID, Row).  Caching
+// row.Encrypted/row.Nonce alongside the already-resolved plainTags
+// lets PopulateCached skip re-resolving RandomTags against TagPairs
+// whenever neither the Row nor the caller's TagPairs have changed
+// since it was last seen.
+type CacheEntry struct {
+	Encrypted []byte    `json:"encrypted"`
+	Nonce     *[24]byte `json:"nonce"`
+	TagPairs  string    `json:"tag_pairs_hash"`
+	PlainTags []string  `json:"plain_tags"`
+	Expires   time.Time `json:"expires"`
+}
+
+// Expired answers whether e is past its TTL.
+func (e *CacheEntry) Expired() bool {
+	return time.Now().After(e.Expires)
+}
+
+// Cache is implemented by anything that can remember a Row's last-
+// seen ciphertext and resolved plain tags, keyed by backend and Row.
+type Cache interface {
+	Get(backendID, rowKey string) (*CacheEntry, bool)
+	Set(backendID, rowKey string, entry *CacheEntry) error
+}
+
+// cacheKey returns a stable identifier for row suitable for use as a
+// Cache key, derived from its RandomTags since those (unlike
+// plainTags) are known before decryption.
+func (row *Row) cacheKey() string {
+	tags := append([]string{}, row.RandomTags...)
+	sort.Strings(tags)
+	sum := sha256.Sum256([]byte(strings.Join(tags, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// PopulateCached is Populate's cache-aware sibling.  If cache has a
+// fresh, still-matching entry for row, its cached plainTags are reused
+// and only Decrypt (not the pairs.WithAllRandomTags lookup) runs;
+// otherwise it falls back to a full Populate and refreshes the cache.
+// Decrypt itself still runs on every call, cache hit or not -- what a
+// hit saves is re-resolving RandomTags against TagPairs, not the
+// decryption.
+//
+// A cached entry only counts as still-matching if pairs hashes the
+// same as it did when the entry was written, in addition to
+// row.Encrypted/row.Nonce being unchanged: otherwise a TagPairs
+// change (e.g. a tag pair added or removed) with the Row's ciphertext
+// untouched would keep serving the old plainTags for up to
+// DefaultCacheTTL.
+func (row *Row) PopulateCached(key *[32]byte, pairs TagPairs, backendID string, cache Cache) error {
+	ck := row.cacheKey()
+	tpHash, tpErr := tagPairsHash(pairs)
+
+	if cache != nil && tpErr == nil {
+		if entry, ok := cache.Get(backendID, ck); ok && !entry.Expired() &&
+			bytes.Equal(entry.Encrypted, row.Encrypted) && nonceEqual(entry.Nonce, row.Nonce) &&
+			entry.TagPairs == tpHash {
+
+			row.plainTags = entry.PlainTags
+			return row.Decrypt(key)
+		}
+	}
+
+	if err := row.Populate(key, pairs); err != nil {
+		return err
+	}
+
+	if cache != nil && tpErr == nil {
+		err := cache.Set(backendID, ck, &CacheEntry{
+			Encrypted: row.Encrypted,
+			Nonce:     row.Nonce,
+			TagPairs:  tpHash,
+			PlainTags: row.plainTags,
+			Expires:   time.Now().Add(DefaultCacheTTL),
+		})
+		if err != nil && Debug {
+			fmt.Printf("PopulateCached: error caching row: %v\n", err)
+		}
+	} else if tpErr != nil && Debug {
+		fmt.Printf("PopulateCached: error hashing TagPairs, not caching: %v\n", tpErr)
+	}
+
+	return nil
+}
+
+// tagPairsHash returns a stable fingerprint of pairs for use in a
+// CacheEntry, so PopulateCached can detect a TagPairs change even when
+// row's ciphertext hasn't changed.  TagPairs has no exported identity
+// of its own to compare against cheaply, so this hashes its JSON
+// encoding instead.
+func tagPairsHash(pairs TagPairs) (string, error) {
+	b, err := json.Marshal(pairs)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling TagPairs: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func nonceEqual(a, b *[24]byte) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// FileCache is the default filesystem-backed Cache.  Every entry is
+// written to its own file under Dir, encrypted at rest with a key
+// derived from the vault's Row key via HKDF so a stolen laptop's disk
+// doesn't leak cached plaintext tags.
+type FileCache struct {
+	Dir string
+	key *[32]byte
+}
+
+// NewFileCache returns a FileCache rooted at dir, deriving its at-rest
+// encryption key from rowKey via HKDF-SHA256 so the cache never
+// stores (or needs) the vault's actual Row key.
+func NewFileCache(dir string, rowKey *[32]byte) (*FileCache, error) {
+	if rowKey == nil {
+		return nil, fmt.Errorf("FileCache: rowKey must not be nil")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("FileCache: error creating cache dir: %v", err)
+	}
+
+	derived := new([32]byte)
+	kdf := hkdf.New(sha256.New, rowKey[:], nil, []byte("cryptag-cache-key-v1"))
+	if _, err := io.ReadFull(kdf, derived[:]); err != nil {
+		return nil, fmt.Errorf("FileCache: error deriving cache key: %v", err)
+	}
+
+	return &FileCache{Dir: dir, key: derived}, nil
+}
+
+func (c *FileCache) path(backendID, rowKey string) string {
+	name := sha256.Sum256([]byte(backendID + "\x00" + rowKey))
+	return filepath.Join(c.Dir, hex.EncodeToString(name[:]))
+}
+
+// Get returns the cached entry for (backendID, rowKey), if any.
+func (c *FileCache) Get(backendID, rowKey string) (*CacheEntry, bool) {
+	enc, err := ioutil.ReadFile(c.path(backendID, rowKey))
+	if err != nil {
+		return nil, false
+	}
+	if len(enc) < 24 {
+		return nil, false
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], enc[:24])
+
+	plain, err := cryptag.Decrypt(enc[24:], &nonce, c.key)
+	if err != nil {
+		return nil, false
+	}
+
+	entry := &CacheEntry{}
+	if err := json.Unmarshal(plain, entry); err != nil {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// Set writes entry for (backendID, rowKey), encrypted with c's
+// HKDF-derived key.
+func (c *FileCache) Set(backendID, rowKey string, entry *CacheEntry) error {
+	plain, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("FileCache: error marshaling entry: %v", err)
+	}
+
+	nonce, err := cryptag.RandomNonce()
+	if err != nil {
+		return err
+	}
+
+	enc, err := cryptag.Encrypt(plain, nonce, c.key)
+	if err != nil {
+		return fmt.Errorf("FileCache: error encrypting entry: %v", err)
+	}
+
+	out := append(append([]byte{}, nonce[:]...), enc...)
+
+	return ioutil.WriteFile(c.path(backendID, rowKey), out, 0600)
+}
@@ -0,0 +1,136 @@
+// Steve Phillips / elimisteve
+// 2015.03.09
+
+package types
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ContentID identifies a Row's plaintext by a keyed hash of its
+// bytes, so two Rows with identical `decrypted` content can share a
+// single ciphertext blob in the backend instead of each getting their
+// own.  It's keyed with a per-vault secret (rather than being a plain
+// content hash) so a backend that only ever sees ContentIDs can't
+// correlate identical plaintext across vaults that don't share a
+// secret.
+type ContentID string
+
+// ComputeContentID returns the ContentID for decrypted, keyed with
+// secret.  The same (secret, decrypted) pair always yields the same
+// ContentID; this is what makes deduplication possible.
+func ComputeContentID(secret *[32]byte, decrypted []byte) (ContentID, error) {
+	if secret == nil {
+		return "", fmt.Errorf("ComputeContentID: secret must not be nil")
+	}
+
+	h, err := blake2b.New256(secret[:])
+	if err != nil {
+		return "", fmt.Errorf("Error creating keyed hash: %v", err)
+	}
+	if _, err := h.Write(decrypted); err != nil {
+		return "", fmt.Errorf("Error hashing decrypted content: %v", err)
+	}
+
+	return ContentID(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// deriveContentNonce deterministically derives the Nonce a
+// content-addressed Row's plaintext must be sealed under, keyed with
+// secret.  Two Rows with the same (secret, decrypted) pair therefore
+// get the same ContentID *and* the same Nonce, so encrypting either
+// one against the vault key produces byte-identical ciphertext --
+// which is what lets the backend store (and dedupe against) a single
+// blob per ContentID instead of one per Row.  A domain-separated
+// personalization string keeps this hash from colliding with
+// ComputeContentID's over the same input.
+func deriveContentNonce(secret *[32]byte, decrypted []byte) (*[24]byte, error) {
+	if secret == nil {
+		return nil, fmt.Errorf("deriveContentNonce: secret must not be nil")
+	}
+
+	h, err := blake2b.New(24, secret[:])
+	if err != nil {
+		return nil, fmt.Errorf("Error creating keyed hash: %v", err)
+	}
+	if _, err := h.Write([]byte("cryptag-content-nonce")); err != nil {
+		return nil, fmt.Errorf("Error hashing nonce personalization: %v", err)
+	}
+	if _, err := h.Write(decrypted); err != nil {
+		return nil, fmt.Errorf("Error hashing decrypted content: %v", err)
+	}
+
+	nonce := new([24]byte)
+	copy(nonce[:], h.Sum(nil))
+	return nonce, nil
+}
+
+// RowRef is a Row's metadata with its plaintext replaced by a
+// ContentID pointing at a shared content blob.  Storing RowRefs
+// separately from content blobs means retagging or re-saving an
+// unchanged payload costs one small RowRef write instead of a full
+// re-encryption of the payload.
+type RowRef struct {
+	RandomTags []string  `json:"tags"`
+	Nonce      *[24]byte `json:"nonce"`
+	ContentID  ContentID `json:"content_id"`
+}
+
+// NewContentAddressedRow is NewRow's sibling for content-addressed
+// storage: it builds a Row exactly as NewRow does, additionally
+// setting row.ContentID and overriding row.Nonce with values derived
+// deterministically from (secret, decrypted).  Two calls with the
+// same secret and decrypted therefore agree on both ContentID and
+// Nonce, so encrypting either resulting Row against the vault key
+// yields identical ciphertext -- the backend can dedupe on ContentID
+// and a shared blob can later be decrypted via any RowRef pointing at
+// it, each using its own (identical) Nonce.
+func NewContentAddressedRow(decrypted []byte, plainTags []string, secret *[32]byte) (*Row, error) {
+	row, err := NewRow(decrypted, plainTags)
+	if err != nil {
+		return nil, err
+	}
+
+	contentID, err := ComputeContentID(secret, decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("Error computing ContentID for new row: %v", err)
+	}
+	nonce, err := deriveContentNonce(secret, decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("Error deriving Nonce for new row: %v", err)
+	}
+
+	row.ContentID = contentID
+	row.Nonce = nonce
+
+	return row, nil
+}
+
+// ToRowRef extracts row's RowRef: its RandomTags, Nonce, and
+// ContentID, with row.Encrypted (the shared content blob) omitted.
+// row.ContentID must already be set, as by NewContentAddressedRow.
+func (row *Row) ToRowRef() (*RowRef, error) {
+	if row.ContentID == "" {
+		return nil, fmt.Errorf("ToRowRef: row has no ContentID; not content-addressed")
+	}
+	return &RowRef{
+		RandomTags: row.RandomTags,
+		Nonce:      row.Nonce,
+		ContentID:  row.ContentID,
+	}, nil
+}
+
+// RowFromRef reconstructs a *Row from a RowRef plus the (still
+// encrypted) content blob bytes it points to, ready to have
+// Decrypt/Populate called on it.
+func RowFromRef(ref *RowRef, encryptedContent []byte) *Row {
+	return &Row{
+		Encrypted:  encryptedContent,
+		RandomTags: ref.RandomTags,
+		Nonce:      ref.Nonce,
+		ContentID:  ref.ContentID,
+	}
+}
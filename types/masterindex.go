@@ -0,0 +1,157 @@
+// Steve Phillips / elimisteve
+// 2015.03.02
+
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/elimisteve/cryptag"
+)
+
+// MasterIndexName is the well-known name the encrypted MasterIndex is
+// stored under in the backend, analogous to row.go's "id:"-prefix
+// convention for Row tags.
+const MasterIndexName = "cryptag:master-index"
+
+// ErrIndexNotFound is the error an IndexBackend must return from Get
+// (wrapped or bare, matchable via errors.Is) when the requested name
+// has never been saved.  LoadMasterIndex and LoadRotationProgress
+// rely on being able to tell this apart from a real backend failure.
+var ErrIndexNotFound = errors.New("types: index entry not found")
+
+// IndexEntry locates a Row's PackEntry within a particular Pack.
+type IndexEntry struct {
+	PackID     string `json:"pack_id"`
+	EntryIndex int    `json:"entry_index"`
+}
+
+// MasterIndex maps every known RandomTag to the Pack and PackEntry
+// that holds its Row's ciphertext, so looking up a Row by random tag
+// becomes an in-memory map read followed by one ranged backend fetch
+// instead of a full listing.
+type MasterIndex struct {
+	mu      sync.RWMutex
+	entries map[string]IndexEntry
+}
+
+// NewMasterIndex returns an empty MasterIndex.
+func NewMasterIndex() *MasterIndex {
+	return &MasterIndex{entries: map[string]IndexEntry{}}
+}
+
+// Add records that randTag's Row lives in packID at entryIndex.
+func (mi *MasterIndex) Add(randTag, packID string, entryIndex int) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	mi.entries[randTag] = IndexEntry{PackID: packID, EntryIndex: entryIndex}
+}
+
+// AddPack records every PackEntry in p under each of its RandomTags.
+func (mi *MasterIndex) AddPack(p *Pack) {
+	for i, entry := range p.Entries {
+		for _, randTag := range entry.RandomTags {
+			mi.Add(randTag, p.ID, i)
+		}
+	}
+}
+
+// Lookup returns where randTag's Row lives, if known.
+func (mi *MasterIndex) Lookup(randTag string) (IndexEntry, bool) {
+	mi.mu.RLock()
+	defer mi.mu.RUnlock()
+	entry, ok := mi.entries[randTag]
+	return entry, ok
+}
+
+// Len returns the number of RandomTags the index knows about.
+func (mi *MasterIndex) Len() int {
+	mi.mu.RLock()
+	defer mi.mu.RUnlock()
+	return len(mi.entries)
+}
+
+// IndexBackend is the subset of backend behavior MasterIndex needs to
+// persist itself: fetch and store a single named, already-encrypted
+// blob plus the nonce it was sealed with.  Get must return (an error
+// matching) ErrIndexNotFound when name hasn't been saved, so callers
+// can distinguish "doesn't exist yet" from a real backend failure.
+type IndexBackend interface {
+	Get(name string) (data []byte, nonce *[24]byte, err error)
+	Save(name string, data []byte, nonce *[24]byte) error
+}
+
+// Save encrypts the index with key and writes it to backend under
+// MasterIndexName, the same way a Pack's own contents are stored
+// encrypted in the backend.
+func (mi *MasterIndex) Save(key *[32]byte, backend IndexBackend) error {
+	mi.mu.RLock()
+	plain, err := json.Marshal(mi.entries)
+	mi.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("masterindex: error marshaling: %v", err)
+	}
+
+	nonce, err := cryptag.RandomNonce()
+	if err != nil {
+		return err
+	}
+
+	enc, err := cryptag.Encrypt(plain, nonce, key)
+	if err != nil {
+		return fmt.Errorf("masterindex: error encrypting: %v", err)
+	}
+
+	return backend.Save(MasterIndexName, enc, nonce)
+}
+
+// LoadMasterIndex fetches and decrypts the MasterIndex previously
+// written by Save.  A missing index (ErrIndexNotFound) is not an
+// error; an empty, freshly-created MasterIndex is returned instead so
+// a vault with no index yet can still be rebuilt incrementally.  Any
+// other error from the backend is returned as-is, since swallowing it
+// here would let a subsequent Save overwrite a good index with an
+// empty one.
+func LoadMasterIndex(key *[32]byte, backend IndexBackend) (*MasterIndex, error) {
+	enc, nonce, err := backend.Get(MasterIndexName)
+	if errors.Is(err, ErrIndexNotFound) {
+		return NewMasterIndex(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("masterindex: error fetching index: %v", err)
+	}
+
+	plain, err := cryptag.Decrypt(enc, nonce, key)
+	if err != nil {
+		return nil, fmt.Errorf("masterindex: error decrypting: %v", err)
+	}
+
+	entries := map[string]IndexEntry{}
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, fmt.Errorf("masterindex: error unmarshaling: %v", err)
+	}
+
+	return &MasterIndex{entries: entries}, nil
+}
+
+// Rebuild replaces the index's contents with a fresh scan of packs,
+// discarding entries for any Pack not present in packs.  Callers
+// should follow a Rebuild with Save to compact the on-disk index,
+// which otherwise only ever grows via Add/AddPack.
+func (mi *MasterIndex) Rebuild(packs []*Pack) {
+	fresh := map[string]IndexEntry{}
+	for _, p := range packs {
+		for i, entry := range p.Entries {
+			for _, randTag := range entry.RandomTags {
+				fresh[randTag] = IndexEntry{PackID: p.ID, EntryIndex: i}
+			}
+		}
+	}
+
+	mi.mu.Lock()
+	mi.entries = fresh
+	mi.mu.Unlock()
+}
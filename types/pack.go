@@ -0,0 +1,114 @@
+// Steve Phillips / elimisteve
+// 2015.03.02
+
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// PackEntry describes one Row's ciphertext within a Pack: the set of
+// RandomTags that identify it, where its bytes live in the pack's
+// data section, and the Nonce needed to decrypt them.
+type PackEntry struct {
+	RandomTags []string  `json:"tags"`
+	Offset     int64     `json:"offset"`
+	Length     int64     `json:"length"`
+	Nonce      *[24]byte `json:"nonce"`
+}
+
+// Pack is an append-only blob holding many Rows' encrypted bytes
+// followed by a trailing header listing a PackEntry per Row.  Packs
+// let "fetch every Row with tag X" become a single ranged read
+// against one backend blob instead of one round trip per Row.
+type Pack struct {
+	ID      string
+	data    bytes.Buffer
+	Entries []PackEntry
+}
+
+// NewPack returns an empty Pack ready to have Rows appended to it.
+func NewPack(id string) *Pack {
+	return &Pack{ID: id}
+}
+
+// Append writes row.Encrypted to the pack's data section and records
+// a PackEntry describing where it landed.  row must already be
+// encrypted (row.Encrypted and row.Nonce set), as by NewRow followed
+// by encryption against a backend key.
+func (p *Pack) Append(row *Row) (PackEntry, error) {
+	if len(row.Encrypted) == 0 {
+		return PackEntry{}, fmt.Errorf("pack: row has no Encrypted bytes to append")
+	}
+	entry := PackEntry{
+		RandomTags: row.RandomTags,
+		Offset:     int64(p.data.Len()),
+		Length:     int64(len(row.Encrypted)),
+		Nonce:      row.Nonce,
+	}
+	if _, err := p.data.Write(row.Encrypted); err != nil {
+		return PackEntry{}, fmt.Errorf("pack: error appending row: %v", err)
+	}
+	p.Entries = append(p.Entries, entry)
+	return entry, nil
+}
+
+// Marshal serializes the pack as: data section, JSON-encoded header,
+// then a trailing 4-byte little-endian header length, mirroring
+// restic's pack-file layout so the header can be located and read
+// with a single ranged request against the tail of the blob.
+func (p *Pack) Marshal() ([]byte, error) {
+	header, err := json.Marshal(p.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("pack: error marshaling header: %v", err)
+	}
+
+	var out bytes.Buffer
+	out.Write(p.data.Bytes())
+	out.Write(header)
+
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(header)))
+	out.Write(lenBuf[:])
+
+	return out.Bytes(), nil
+}
+
+// UnmarshalPack parses a blob previously produced by Pack.Marshal:
+// it decodes the trailing header into Entries and copies the whole
+// data section into the Pack, from which ReadEntry later slices a
+// particular entry's bytes.
+func UnmarshalPack(id string, b []byte) (*Pack, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("pack: blob too short to contain a header length")
+	}
+
+	headerLen := binary.LittleEndian.Uint32(b[len(b)-4:])
+	headerStart := len(b) - 4 - int(headerLen)
+	if headerStart < 0 {
+		return nil, fmt.Errorf("pack: invalid header length %d", headerLen)
+	}
+
+	var entries []PackEntry
+	if err := json.Unmarshal(b[headerStart:len(b)-4], &entries); err != nil {
+		return nil, fmt.Errorf("pack: error unmarshaling header: %v", err)
+	}
+
+	p := &Pack{ID: id, Entries: entries}
+	p.data.Write(b[:headerStart])
+
+	return p, nil
+}
+
+// ReadEntry returns the raw (still encrypted) bytes for entry, which
+// must have come from this same Pack.
+func (p *Pack) ReadEntry(entry PackEntry) ([]byte, error) {
+	data := p.data.Bytes()
+	if entry.Offset < 0 || entry.Offset+entry.Length > int64(len(data)) {
+		return nil, fmt.Errorf("pack: entry out of range for pack %s", p.ID)
+	}
+	return data[entry.Offset : entry.Offset+entry.Length], nil
+}
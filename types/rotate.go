@@ -0,0 +1,211 @@
+// Steve Phillips / elimisteve
+// 2015.03.30
+
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/elimisteve/cryptag"
+)
+
+// Rotate re-encrypts every row in rows from oldKey to newKey in
+// place: each row is decrypted with oldKey, given a fresh Nonce via
+// cryptag.RandomNonce, and re-encrypted with newKey.  row.RandomTags
+// and row.ContentID are left untouched, since only the encryption key
+// is changing.
+//
+// A row that's already sealed under newKey (as can happen resuming a
+// rotation interrupted between saving a re-encrypted row and
+// persisting that fact, see RotateBackend) is left untouched rather
+// than erroring, so resuming is safe even if that happened.
+func Rotate(rows []*Row, oldKey, newKey *[32]byte) error {
+	for _, row := range rows {
+		if rowDecryptsWith(row, newKey) {
+			continue
+		}
+
+		if err := row.Decrypt(oldKey); err != nil {
+			return fmt.Errorf("Rotate: error decrypting row: %v", err)
+		}
+
+		nonce, err := cryptag.RandomNonce()
+		if err != nil {
+			return err
+		}
+
+		enc, err := cryptag.Encrypt(row.decrypted, nonce, newKey)
+		if err != nil {
+			return fmt.Errorf("Rotate: error re-encrypting row: %v", err)
+		}
+
+		row.Encrypted = enc
+		row.Nonce = nonce
+	}
+
+	return nil
+}
+
+// rowDecryptsWith answers whether row.Encrypted/row.Nonce already
+// decrypt successfully under key, without mutating row.
+func rowDecryptsWith(row *Row, key *[32]byte) bool {
+	probe := &Row{Encrypted: row.Encrypted, Nonce: row.Nonce}
+	return probe.Decrypt(key) == nil
+}
+
+// RotationBackend is the subset of backend behavior a resumable key
+// rotation needs: list every row, durably save a re-encrypted row,
+// and delete the old blob once its replacement is durable.  It embeds
+// IndexBackend so rotation progress can be persisted the same way a
+// MasterIndex is.
+//
+// DeleteRow must only ever remove the specific stored blob row
+// identifies, never a logical row identity (e.g. "whatever blob
+// RandomTags currently names") that SaveRow may have already
+// overwritten with the replacement: RotateBackend calls SaveRow on the
+// re-encrypted row before calling DeleteRow on the pre-rotation one,
+// and for a backend that stores one blob per RandomTags set, those two
+// Rows name the same blob.  RowKey exists so RotateBackend can detect
+// that case via equal keys and skip the now-dangerous DeleteRow call
+// rather than deleting the row it just saved.
+type RotationBackend interface {
+	ListRows() ([]*Row, error)
+	SaveRow(row *Row) error
+	DeleteRow(row *Row) error
+
+	// RowKey returns the backend-specific storage identity of row's
+	// blob -- whatever two Rows must share (RandomTags, a ciphertext
+	// digest, ContentID, ...) to mean "the same stored blob" to this
+	// backend.
+	RowKey(row *Row) string
+
+	IndexBackend
+}
+
+// RotationProgress tracks which rows a key rotation has already
+// finished, so an interrupted rotation can resume without re-doing
+// work or leaving a row re-encrypted twice.  It's persisted under a
+// well-known tag, "cryptag:rotation:<startedAt>", like a MasterIndex.
+type RotationProgress struct {
+	Tag       string          `json:"tag"`
+	Completed map[string]bool `json:"completed"`
+}
+
+// NewRotationProgress returns an empty RotationProgress tagged with
+// startedAt (e.g. a fresh cryptag.TimeStr(cryptag.Now())).
+func NewRotationProgress(startedAt string) *RotationProgress {
+	return &RotationProgress{
+		Tag:       "cryptag:rotation:" + startedAt,
+		Completed: map[string]bool{},
+	}
+}
+
+// Save encrypts and persists progress with key, the same way
+// MasterIndex.Save does.
+func (p *RotationProgress) Save(key *[32]byte, backend IndexBackend) error {
+	plain, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("RotationProgress: error marshaling: %v", err)
+	}
+
+	nonce, err := cryptag.RandomNonce()
+	if err != nil {
+		return err
+	}
+
+	enc, err := cryptag.Encrypt(plain, nonce, key)
+	if err != nil {
+		return fmt.Errorf("RotationProgress: error encrypting: %v", err)
+	}
+
+	return backend.Save(p.Tag, enc, nonce)
+}
+
+// LoadRotationProgress fetches and decrypts a previously-saved
+// RotationProgress.  A missing marker (ErrIndexNotFound) is not an
+// error; a fresh, empty RotationProgress tagged with tag is returned
+// instead so a rotation that's never been started can begin normally.
+// Any other backend error is returned as-is rather than silently
+// restarting the rotation from scratch.
+func LoadRotationProgress(tag string, key *[32]byte, backend IndexBackend) (*RotationProgress, error) {
+	enc, nonce, err := backend.Get(tag)
+	if errors.Is(err, ErrIndexNotFound) {
+		return &RotationProgress{Tag: tag, Completed: map[string]bool{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("RotationProgress: error fetching progress marker: %v", err)
+	}
+
+	plain, err := cryptag.Decrypt(enc, nonce, key)
+	if err != nil {
+		return nil, fmt.Errorf("RotationProgress: error decrypting: %v", err)
+	}
+
+	p := &RotationProgress{}
+	if err := json.Unmarshal(plain, p); err != nil {
+		return nil, fmt.Errorf("RotationProgress: error unmarshaling: %v", err)
+	}
+
+	return p, nil
+}
+
+// RotateBackend walks every row in backend, re-encrypting each from
+// oldKey to newKey and persisting progress so the rotation can be
+// safely interrupted and resumed: a row already marked Completed in
+// progress is skipped, and a row found already sealed under newKey
+// (Rotate's doing, see rowDecryptsWith) is treated as done rather than
+// re-rotated or rejected.
+//
+// Per row, the order is: save the re-encrypted row, mark and persist
+// it Completed, *then* delete the old blob -- so a crash can leave a
+// row re-encrypted-but-unmarked (which Rotate's newKey check on resume
+// handles), or marked Completed with its old blob not yet deleted
+// (resume skips it, so that old blob stays), but never
+// decrypted-and-lost.  The old
+// blob is only actually deleted if backend.RowKey says it differs from
+// the just-saved row's; otherwise SaveRow already overwrote it in
+// place and calling DeleteRow would delete the replacement instead.
+func RotateBackend(backend RotationBackend, oldKey, newKey *[32]byte, progress *RotationProgress) error {
+	rows, err := backend.ListRows()
+	if err != nil {
+		return fmt.Errorf("RotateBackend: error listing rows: %v", err)
+	}
+
+	for _, row := range rows {
+		key := row.cacheKey()
+		if progress.Completed[key] {
+			continue
+		}
+
+		alreadyRotated := rowDecryptsWith(row, newKey)
+
+		var old *Row
+		if !alreadyRotated {
+			old = &Row{Encrypted: row.Encrypted, RandomTags: row.RandomTags, Nonce: row.Nonce, ContentID: row.ContentID}
+
+			if err := Rotate([]*Row{row}, oldKey, newKey); err != nil {
+				return err
+			}
+			if err := backend.SaveRow(row); err != nil {
+				return fmt.Errorf("RotateBackend: error saving re-encrypted row: %v", err)
+			}
+		}
+
+		progress.Completed[key] = true
+		if err := progress.Save(newKey, backend); err != nil {
+			return fmt.Errorf("RotateBackend: error saving progress: %v", err)
+		}
+
+		if !alreadyRotated {
+			if backend.RowKey(old) != backend.RowKey(row) {
+				if err := backend.DeleteRow(old); err != nil {
+					return fmt.Errorf("RotateBackend: error deleting old row: %v", err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
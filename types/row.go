@@ -20,6 +20,11 @@ type Row struct {
 	Encrypted  []byte   `json:"data"`
 	RandomTags []string `json:"tags"`
 
+	// ContentID is set when this Row was created with
+	// NewContentAddressedRow; it names the (possibly shared)
+	// content blob holding Encrypted.  Empty for ordinary Rows.
+	ContentID ContentID `json:"content_id,omitempty"`
+
 	// Populated locally
 	decrypted []byte
 	plainTags []string
@@ -82,6 +87,26 @@ func NewRowFromBytes(b []byte) (*Row, error) {
 	return row, nil
 }
 
+// NewRowFromPack is NewRowFromBytes's sibling for Rows stored inside
+// a Pack: it reads entry's (still encrypted) bytes out of pack and
+// populates a new *Row's Encrypted, Nonce and RandomTags from them,
+// without yet decrypting.
+func NewRowFromPack(pack *Pack, entry PackEntry) (*Row, error) {
+	enc, err := pack.ReadEntry(entry)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading row from pack: %v", err)
+	}
+	row := &Row{
+		Encrypted:  enc,
+		RandomTags: entry.RandomTags,
+		Nonce:      entry.Nonce,
+	}
+	if Debug {
+		log.Printf("Created new Row `%#v` from pack `%s`\n", row, pack.ID)
+	}
+	return row, nil
+}
+
 // Decrypted returns row.decrypted, row's (unexported) decrypted data (if any).
 func (row *Row) Decrypted() []byte {
 	return row.decrypted
@@ -137,6 +162,24 @@ func (row *Row) Decrypt(key *[32]byte) error {
 	return nil
 }
 
+// DecryptFromPack is Decrypt's sibling for a Row backed by a Pack: it
+// reads row.Encrypted/row.Nonce out of pack via entry before
+// decrypting, so callers that already have a Pack in hand (e.g. after
+// a MasterIndex lookup) don't need to materialize a standalone blob
+// first.
+func (row *Row) DecryptFromPack(pack *Pack, entry PackEntry, key *[32]byte) error {
+	enc, err := pack.ReadEntry(entry)
+	if err != nil {
+		return fmt.Errorf("Error reading row from pack: %v", err)
+	}
+
+	row.Encrypted = enc
+	row.Nonce = entry.Nonce
+	row.RandomTags = entry.RandomTags
+
+	return row.Decrypt(key)
+}
+
 // SetPlainTags uses row.RandomTags and pairs to set row.plainTags
 func (row *Row) SetPlainTags(pairs TagPairs) error {
 	matches, err := pairs.WithAllRandomTags(row.RandomTags)
@@ -165,3 +208,15 @@ func (row *Row) Populate(key *[32]byte, pairs TagPairs) error {
 	}
 	return nil
 }
+
+// PopulateFromPack is Populate's sibling for a Row backed by a Pack;
+// see DecryptFromPack.
+func (row *Row) PopulateFromPack(pack *Pack, entry PackEntry, key *[32]byte, pairs TagPairs) error {
+	if err := row.DecryptFromPack(pack, entry, key); err != nil {
+		return fmt.Errorf("Error decrypting row: %v", err)
+	}
+	if err := row.SetPlainTags(pairs); err != nil {
+		return fmt.Errorf("Error setting row's plain tags: %v", err)
+	}
+	return nil
+}
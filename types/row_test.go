@@ -0,0 +1,48 @@
+// Steve Phillips / elimisteve
+// 2015.03.24
+
+package types
+
+import (
+	"testing"
+
+	"github.com/elimisteve/cryptag/recovery"
+)
+
+// TestNewRowKeyRecoveryRoundTrip creates a Row with NewRow and checks
+// that a 32-byte Row key can be backed up and restored via the
+// recovery package, even after misremembering one word of the recovery
+// phrase -- the key NewRow's caller would otherwise have to keep
+// around forever to ever decrypt the Row again.  The Row itself is not
+// encrypted with the key here.
+func TestNewRowKeyRecoveryRoundTrip(t *testing.T) {
+	key := new([32]byte)
+	for i := range key {
+		key[i] = byte(i * 3)
+	}
+
+	row, err := NewRow([]byte("hello, cryptag"), []string{"greeting"})
+	if err != nil {
+		t.Fatalf("NewRow: %v", err)
+	}
+	if row.Nonce == nil {
+		t.Fatal("NewRow: row.Nonce is nil")
+	}
+
+	words, err := recovery.EncodeKey(key)
+	if err != nil {
+		t.Fatalf("recovery.EncodeKey: %v", err)
+	}
+
+	// Simulate misremembering the middle word of the phrase.
+	misremembered := append([]string{}, words...)
+	misremembered[len(misremembered)/2] = "notarealword"
+
+	recovered, err := recovery.DecodeKey(misremembered)
+	if err != nil {
+		t.Fatalf("recovery.DecodeKey: %v", err)
+	}
+	if *recovered != *key {
+		t.Fatalf("recovered key %x != original key %x", *recovered, *key)
+	}
+}